@@ -31,6 +31,7 @@ import (
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/client/record"
 	"k8s.io/kubernetes/pkg/client/unversioned"
 	"k8s.io/kubernetes/pkg/fields"
 	utildbus "k8s.io/kubernetes/pkg/util/dbus"
@@ -47,6 +48,9 @@ const (
 
 var (
 	keyFunc = cache.DeletionHandlingMetaNamespaceKeyFunc
+
+	// Error used to indicate that a sync is deferred because the controller isn't ready yet
+	errDeferredSync = fmt.Errorf("deferring sync till endpoints controller has synced")
 )
 
 type service struct {
@@ -77,6 +81,8 @@ type vip struct {
 	Protocol  string
 	LVSMethod string
 	Backends  []service
+	// VRID of the vrrp instance announcing the IP
+	VRID int
 }
 
 type vipByNameIPPort []vip
@@ -111,10 +117,25 @@ type ipvsControllerController struct {
 	epLister          cache.StoreToEndpointsLister
 	reloadRateLimiter flowcontrol.RateLimiter
 	keepalived        *keepalived
+	recorder          record.EventRecorder
 	configMapName     string
 	ruCfg             []vip
 	ruMD5             string
 
+	// invalidEntries contains the entries of the configmap already reported
+	// as invalid with an event.
+	// k -> IP to use
+	// v -> value of the entry when it was reported
+	invalidEntries map[string]string
+
+	// dryRun indicates that the generated configuration must be printed
+	// to dryRunOutput instead of being written and loaded by keepalived.
+	dryRun       bool
+	dryRunOutput io.Writer
+
+	// reload is called to load a new configuration in keepalived
+	reload func() error
+
 	// stopLock is used to enforce only a single call to Stop is active.
 	// Needed because we allow stopping through an http endpoint and
 	// allowing concurrent stoppers leads to stack traces.
@@ -167,10 +188,22 @@ func (ipvsc *ipvsControllerController) getEndpoints(
 // getServices returns a list of services and their endpoints.
 func (ipvsc *ipvsControllerController) getServices(cfgMap *api.ConfigMap) []vip {
 	svcs := []vip{}
+	invalid := map[string]string{}
 
 	// k -> IP to use
-	// v -> <namespace>/<service name>:<lvs method>
-	for externalIP, nsSvcLvs := range cfgMap.Data {
+	// v -> <namespace>/<service name>:<lvs method>@<vrid>
+	for externalIP, value := range cfgMap.Data {
+		nsSvcLvs, vrid, err := parseVRID(value)
+		if err != nil {
+			ipvsc.invalidEntry(cfgMap, externalIP, value, "InvalidVRID", err)
+			invalid[externalIP] = value
+			continue
+		}
+
+		if vrid == -1 {
+			vrid = ipvsc.keepalived.vrid
+		}
+
 		if nsSvcLvs == "" {
 			// if target is empty string we will not forward to any service but
 			// instead just configure the IP on the machine and let it up to
@@ -182,30 +215,19 @@ func (ipvsc *ipvsControllerController) getServices(cfgMap *api.ConfigMap) []vip
 				LVSMethod: "VIP",
 				Backends:  nil,
 				Protocol:  "TCP",
+				VRID:      vrid,
 			})
 			glog.V(2).Infof("Adding VIP only service: %v", externalIP)
 			continue
 		}
 
-		ns, svc, lvsm, err := parseNsSvcLVS(nsSvcLvs)
+		s, lvsm, err := ipvsc.getServiceRef(nsSvcLvs)
 		if err != nil {
-			glog.Warningf("%v", err)
+			ipvsc.invalidEntry(cfgMap, externalIP, value, "InvalidService", err)
+			invalid[externalIP] = value
 			continue
 		}
 
-		nsSvc := fmt.Sprintf("%v/%v", ns, svc)
-		svcObj, svcExists, err := ipvsc.svcLister.Indexer.GetByKey(nsSvc)
-		if err != nil {
-			glog.Warningf("error getting service %v: %v", nsSvc, err)
-			continue
-		}
-
-		if !svcExists {
-			glog.Warningf("service %v not found", nsSvc)
-			continue
-		}
-
-		s := svcObj.(*api.Service)
 		for _, servicePort := range s.Spec.Ports {
 			ep := ipvsc.getEndpoints(s, &servicePort)
 			if len(ep) == 0 {
@@ -222,16 +244,57 @@ func (ipvsc *ipvsControllerController) getServices(cfgMap *api.ConfigMap) []vip
 				LVSMethod: lvsm,
 				Backends:  ep,
 				Protocol:  fmt.Sprintf("%v", servicePort.Protocol),
+				VRID:      vrid,
 			})
 			glog.V(2).Infof("found service: %v:%v", s.Name, servicePort.Port)
 		}
 	}
 
+	// entries fixed or removed from the configmap are forgotten so they are
+	// reported again if they become invalid
+	ipvsc.invalidEntries = invalid
+
 	sort.Sort(vipByNameIPPort(svcs))
 
 	return svcs
 }
 
+// getServiceRef returns the service and the LVS method referenced by a value
+// of the configmap with the format <namespace>/<service name>:<lvs method>.
+// Returns an error if the format is not valid or the service does not exist.
+func (ipvsc *ipvsControllerController) getServiceRef(nsSvcLvs string) (*api.Service, string, error) {
+	ns, svc, lvsm, err := parseNsSvcLVS(nsSvcLvs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nsSvc := fmt.Sprintf("%v/%v", ns, svc)
+	svcObj, svcExists, err := ipvsc.svcLister.Indexer.GetByKey(nsSvc)
+	if err != nil {
+		return nil, "", fmt.Errorf("error getting service %v: %v", nsSvc, err)
+	}
+
+	if !svcExists {
+		return nil, "", fmt.Errorf("service %v not found", nsSvc)
+	}
+
+	return svcObj.(*api.Service), lvsm, nil
+}
+
+// invalidEntry reports an entry of the configmap that cannot be used in the
+// log and as a warning event of the configmap. The event is recorded only
+// when the entry becomes invalid or its value changes to avoid one event per
+// sync.
+func (ipvsc *ipvsControllerController) invalidEntry(cfgMap *api.ConfigMap, externalIP, value, reason string, err error) {
+	if reported, ok := ipvsc.invalidEntries[externalIP]; ok && reported == value {
+		glog.V(2).Infof("skipping VIP %v: %v", externalIP, err)
+		return
+	}
+
+	glog.Warningf("skipping VIP %v: %v", externalIP, err)
+	ipvsc.recorder.Eventf(cfgMap, api.EventTypeWarning, reason, "skipping VIP %v: %v", externalIP, err)
+}
+
 func (ipvsc *ipvsControllerController) getConfigMap(ns, name string) (*api.ConfigMap, error) {
 	return ipvsc.client.ConfigMaps(ns).Get(name)
 }
@@ -242,7 +305,7 @@ func (ipvsc *ipvsControllerController) sync(key string) error {
 
 	if !ipvsc.epController.HasSynced() || !ipvsc.svcController.HasSynced() {
 		time.Sleep(100 * time.Millisecond)
-		return fmt.Errorf("deferring sync till endpoints controller has synced")
+		return errDeferredSync
 	}
 
 	ns, name, err := parseNsName(ipvsc.configMapName)
@@ -258,19 +321,31 @@ func (ipvsc *ipvsControllerController) sync(key string) error {
 	svc := ipvsc.getServices(cfgMap)
 	ipvsc.ruCfg = svc
 
-	err = ipvsc.keepalived.WriteCfg(svc)
+	return ipvsc.apply(svc, keepalivedCfg)
+}
+
+// apply writes the keepalived configuration for the given services to
+// cfgPath and reloads keepalived if the configuration changed.
+// In dry-run mode the configuration is printed to dryRunOutput instead,
+// and neither the file nor keepalived are touched.
+func (ipvsc *ipvsControllerController) apply(svcs []vip, cfgPath string) error {
+	if ipvsc.dryRun {
+		return ipvsc.keepalived.DumpCfg(ipvsc.dryRunOutput, svcs)
+	}
+
+	err := ipvsc.keepalived.WriteCfg(cfgPath, svcs)
 	if err != nil {
 		return err
 	}
-	glog.V(2).Infof("services: %v", svc)
+	glog.V(2).Infof("services: %v", svcs)
 
-	md5, err := checksum(keepalivedCfg)
+	md5, err := checksum(cfgPath)
 	if err == nil && md5 == ipvsc.ruMD5 {
 		return nil
 	}
 
 	ipvsc.ruMD5 = md5
-	err = ipvsc.keepalived.Reload()
+	err = ipvsc.reload()
 	if err != nil {
 		glog.Errorf("error reloading keepalived: %v", err)
 	}
@@ -300,13 +375,15 @@ func (ipvsc *ipvsControllerController) Stop() error {
 }
 
 // newIPVSController creates a new controller from the given config.
-func newIPVSController(kubeClient *unversioned.Client, namespace string, useUnicast bool, configMapName string, vrid int, vrrpVersion int) *ipvsControllerController {
+func newIPVSController(kubeClient *unversioned.Client, namespace string, useUnicast bool, configMapName string, vrid int, vrrpVersion int, dryRun bool, trackScript *vrrpScript, garpMasterDelay, garpMasterRefresh time.Duration) *ipvsControllerController {
 	ipvsc := ipvsControllerController{
 		client:            kubeClient,
 		reloadRateLimiter: flowcontrol.NewTokenBucketRateLimiter(reloadQPS, int(reloadQPS)),
 		ruCfg:             []vip{},
 		configMapName:     configMapName,
 		stopCh:            make(chan struct{}),
+		dryRun:            dryRun,
+		dryRunOutput:      os.Stdout,
 	}
 
 	podInfo, err := getPodDetails(kubeClient)
@@ -335,8 +412,34 @@ func newIPVSController(kubeClient *unversioned.Client, namespace string, useUnic
 		glog.Fatalf("Error using VRRP %d, only values between 2 and 3 are allowed.", vrrpVersion)
 	}
 
+	garpDelay, err := durationToSeconds("garp master delay", garpMasterDelay)
+	if err != nil {
+		glog.Fatalf("Error using gratuitous ARP settings: %v", err)
+	}
+
+	garpRefresh, err := durationToSeconds("garp master refresh", garpMasterRefresh)
+	if err != nil {
+		glog.Fatalf("Error using gratuitous ARP settings: %v", err)
+	}
+
+	if trackScript != nil {
+		if err := trackScript.validate(); err != nil {
+			glog.Fatalf("Error using track script: %v", err)
+		}
+	}
+
 	neighbors := getNodeNeighbors(nodeInfo, clusterNodes)
 
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(glog.Infof)
+	if !dryRun {
+		eventBroadcaster.StartRecordingToSink(kubeClient.Events(""))
+	}
+	ipvsc.recorder = eventBroadcaster.NewRecorder(api.EventSource{
+		Component: "keepalived-vip",
+		Host:      pod.Spec.NodeName,
+	})
+
 	notify := os.Getenv("KEEPALIVED_NOTIFY")
 
 	execer := exec.New()
@@ -355,8 +458,14 @@ func newIPVSController(kubeClient *unversioned.Client, namespace string, useUnic
 		vrid:        vrid,
 		vrrpVersion: vrrpVersion,
 		notify:      notify,
+		trackScript: trackScript,
+
+		garpMasterDelay:   garpDelay,
+		garpMasterRefresh: garpRefresh,
 	}
 
+	ipvsc.reload = ipvsc.keepalived.Reload
+
 	ipvsc.syncQueue = NewTaskQueue(ipvsc.sync)
 
 	err = ipvsc.keepalived.loadTemplate()
@@ -0,0 +1,208 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/client/record"
+	"k8s.io/kubernetes/pkg/util/intstr"
+)
+
+func newTestIPVSController() (*ipvsControllerController, *record.FakeRecorder) {
+	recorder := record.NewFakeRecorder(10)
+	ipvsc := &ipvsControllerController{
+		keepalived: &keepalived{vrid: 50},
+		recorder:   recorder,
+	}
+	ipvsc.svcLister.Indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	ipvsc.epLister.Store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+
+	meta := api.ObjectMeta{Name: "echoheaders", Namespace: api.NamespaceDefault}
+	ipvsc.svcLister.Indexer.Add(&api.Service{
+		ObjectMeta: meta,
+		Spec: api.ServiceSpec{
+			Ports: []api.ServicePort{
+				{Port: 80, TargetPort: intstr.FromInt(8080), Protocol: api.ProtocolTCP},
+			},
+		},
+	})
+	ipvsc.epLister.Store.Add(&api.Endpoints{
+		ObjectMeta: meta,
+		Subsets: []api.EndpointSubset{
+			{
+				Addresses: []api.EndpointAddress{{IP: "10.2.68.5"}},
+				Ports:     []api.EndpointPort{{Port: 8080, Protocol: api.ProtocolTCP}},
+			},
+		},
+	})
+
+	return ipvsc, recorder
+}
+
+func TestGetServicesValidation(t *testing.T) {
+	testcases := map[string]struct {
+		Value  string
+		VIPs   int
+		Reason string
+	}{
+		"valid service":          {"default/echoheaders", 1, ""},
+		"valid service and VRID": {"default/echoheaders:DR@51", 1, ""},
+		"VIP only":               {"", 1, ""},
+		"missing service":        {"default/missing", 0, "InvalidService"},
+		"missing namespace":      {"echoheaders", 0, "InvalidService"},
+		"empty namespace":        {"/echoheaders", 0, "InvalidService"},
+		"empty service name":     {"default/:NAT", 0, "InvalidService"},
+		"invalid LVS method":     {"default/echoheaders:AJAX", 0, "InvalidService"},
+		"invalid VRID":           {"default/echoheaders@300", 0, "InvalidVRID"},
+	}
+
+	for k, tc := range testcases {
+		ipvsc, recorder := newTestIPVSController()
+		cfgMap := &api.ConfigMap{
+			ObjectMeta: api.ObjectMeta{Name: "vip-configmap", Namespace: api.NamespaceDefault},
+			Data:       map[string]string{"10.4.0.50": tc.Value},
+		}
+
+		svcs := ipvsc.getServices(cfgMap)
+		if len(svcs) != tc.VIPs {
+			t.Errorf("%s: expected %v VIPs but returned %v: %+v", k, tc.VIPs, len(svcs), svcs)
+		}
+
+		select {
+		case event := <-recorder.Events:
+			if tc.Reason == "" {
+				t.Errorf("%s: unexpected event %q", k, event)
+			} else if !strings.HasPrefix(event, api.EventTypeWarning+" "+tc.Reason+" skipping VIP 10.4.0.50") {
+				t.Errorf("%s: expected a %v warning event but got %q", k, tc.Reason, event)
+			}
+		default:
+			if tc.Reason != "" {
+				t.Errorf("%s: expected a %v warning event", k, tc.Reason)
+			}
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	svcs := []vip{
+		{
+			Name:      "default/echoheaders",
+			IP:        "10.4.0.50",
+			Port:      80,
+			Protocol:  "TCP",
+			LVSMethod: "NAT",
+			Backends:  []service{{IP: "10.2.68.5", Port: 8080}},
+			VRID:      50,
+		},
+	}
+
+	testcases := map[string]struct {
+		dryRun  bool
+		written bool
+		reloads int
+		printed bool
+	}{
+		"dry run":     {true, false, 0, true},
+		"not dry run": {false, true, 1, false},
+	}
+
+	for k, tc := range testcases {
+		dir, err := ioutil.TempDir("", "keepalived")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", k, err)
+		}
+		defer os.RemoveAll(dir)
+		cfgPath := filepath.Join(dir, "keepalived.conf")
+
+		var out bytes.Buffer
+		reloads := 0
+		ipvsc := &ipvsControllerController{
+			keepalived:   newTestKeepalived(t),
+			dryRun:       tc.dryRun,
+			dryRunOutput: &out,
+			reload: func() error {
+				reloads++
+				return nil
+			},
+		}
+
+		// the second call with the same services must not reload keepalived
+		for i := 0; i < 2; i++ {
+			if err := ipvsc.apply(svcs, cfgPath); err != nil {
+				t.Fatalf("%s: unexpected error: %v", k, err)
+			}
+		}
+
+		_, err = os.Stat(cfgPath)
+		if tc.written && err != nil {
+			t.Errorf("%s: expected the configuration file to be written: %v", k, err)
+		}
+		if !tc.written && !os.IsNotExist(err) {
+			t.Errorf("%s: expected no configuration file but got: %v", k, err)
+		}
+
+		if reloads != tc.reloads {
+			t.Errorf("%s: expected %v reloads but got %v", k, tc.reloads, reloads)
+		}
+
+		printed := strings.Contains(out.String(), "virtual_server 10.4.0.50 80 {")
+		if printed != tc.printed {
+			t.Errorf("%s: expected configuration printed to be %v but got:\n%v", k, tc.printed, out.String())
+		}
+	}
+}
+
+func TestGetServicesInvalidEntryEvents(t *testing.T) {
+	ipvsc, recorder := newTestIPVSController()
+	cfgMap := &api.ConfigMap{
+		ObjectMeta: api.ObjectMeta{Name: "vip-configmap", Namespace: api.NamespaceDefault},
+		Data:       map[string]string{},
+	}
+
+	steps := []struct {
+		Value  string
+		Events int
+	}{
+		{"default/missing", 1},
+		// the same invalid entry must not be reported again
+		{"default/missing", 0},
+		{"default/other", 1},
+		{"default/echoheaders", 0},
+		// a fixed entry is reported again if it becomes invalid
+		{"default/other", 1},
+	}
+
+	for i, step := range steps {
+		cfgMap.Data["10.4.0.50"] = step.Value
+		ipvsc.getServices(cfgMap)
+
+		if n := len(recorder.Events); n != step.Events {
+			t.Errorf("step %v: expected %v events but returned %v - input %v", i, step.Events, n, step.Value)
+		}
+		for len(recorder.Events) > 0 {
+			<-recorder.Events
+		}
+	}
+}
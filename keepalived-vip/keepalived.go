@@ -19,8 +19,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 	"text/template"
 
@@ -52,32 +56,126 @@ type keepalived struct {
 	vrid        int
 	vrrpVersion int
 	notify      string
+	trackScript *vrrpScript
+	// garpMasterDelay and garpMasterRefresh are expressed in seconds
+	garpMasterDelay   int
+	garpMasterRefresh int
 }
 
-// WriteCfg creates a new keepalived configuration file.
+// vrrpInstance is a group of VIPs announced by keepalived using the same VRID
+type vrrpInstance struct {
+	Name string
+	VRID int
+	VIPs []string
+}
+
+// vrrpScript is a health check executed periodically by keepalived.
+// The vrrp instance tracks the result to adjust its priority.
+type vrrpScript struct {
+	// Script is the command to execute: an absolute path and optional arguments
+	Script string
+	// Interval is the number of seconds between two executions of the script
+	Interval int
+	// Weight is applied to the priority of the node according to the result
+	// of the script: a negative value is subtracted while the script fails
+	// and a positive one is added while the script succeeds. If 0, a failure
+	// moves the instance to the FAULT state and the VIPs are released.
+	Weight int
+}
+
+// validate checks the script is an executable file and the interval and
+// weight are within the ranges accepted by keepalived.
+func (s *vrrpScript) validate() error {
+	// the script is rendered between double quotes in keepalived.conf
+	if strings.ContainsAny(s.Script, "\"\r\n") {
+		return fmt.Errorf("the track script cannot contain double quotes or new lines")
+	}
+
+	args := strings.Fields(s.Script)
+	if len(args) == 0 {
+		return fmt.Errorf("the track script cannot be empty")
+	}
+
+	path := args[0]
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("the track script %v must be an absolute path", path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("invalid track script: %v", err)
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("the track script %v is not an executable file", path)
+	}
+
+	if s.Interval < 1 {
+		return fmt.Errorf("invalid track script interval %v, it must be at least 1 second", s.Interval)
+	}
+
+	if s.Weight < -254 || s.Weight > 254 {
+		return fmt.Errorf("invalid track script weight %v, only values between -254 and 254 are allowed", s.Weight)
+	}
+
+	return nil
+}
+
+// WriteCfg creates a new keepalived configuration file in the given path.
 // In case of an error with the generation it returns the error
-func (k *keepalived) WriteCfg(svcs []vip) error {
-	w, err := os.Create(keepalivedCfg)
+func (k *keepalived) WriteCfg(path string, svcs []vip) error {
+	w, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 	defer w.Close()
 
+	return k.renderCfg(w, svcs)
+}
+
+// DumpCfg writes the keepalived configuration and the list of IPVS virtual
+// servers that would be programmed to w. Nothing is written to the local
+// system, which makes it suitable for a dry run.
+func (k *keepalived) DumpCfg(w io.Writer, svcs []vip) error {
+	if err := k.renderCfg(w, svcs); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\n# IPVS services\n")
+	for _, svc := range svcs {
+		if svc.LVSMethod == "VIP" {
+			fmt.Fprintf(w, "VIP %v (no backends)\n", svc.IP)
+			continue
+		}
+		fmt.Fprintf(w, "%v %v:%v %v (%v)\n", svc.Protocol, svc.IP, svc.Port, svc.LVSMethod, svc.Name)
+		for _, backend := range svc.Backends {
+			fmt.Fprintf(w, "  -> %v:%v\n", backend.IP, backend.Port)
+		}
+	}
+
+	return nil
+}
+
+// renderCfg executes the keepalived template for the given services.
+func (k *keepalived) renderCfg(w io.Writer, svcs []vip) error {
 	k.vips = getVIPs(svcs)
 
+	instances := getInstances(k.vrid, svcs)
+
 	conf := make(map[string]interface{})
 	conf["iptablesChain"] = iptablesChain
 	conf["iface"] = k.iface
 	conf["myIP"] = k.ip
 	conf["netmask"] = k.netmask
 	conf["svcs"] = svcs
-	conf["vips"] = getVIPs(svcs)
+	conf["instances"] = instances
 	conf["nodes"] = k.neighbors
 	conf["priority"] = k.priority
 	conf["useUnicast"] = k.useUnicast
-	conf["vrid"] = k.vrid
 	conf["vrrpVersion"] = k.vrrpVersion
 	conf["notify"] = k.notify
+	conf["trackScript"] = k.trackScript
+	conf["garpMasterDelay"] = k.garpMasterDelay
+	conf["garpMasterRefresh"] = k.garpMasterRefresh
 
 	if glog.V(2) {
 		b, _ := json.Marshal(conf)
@@ -98,6 +196,36 @@ func getVIPs(svcs []vip) []string {
 	return result
 }
 
+// getInstances groups the VIPs by VRID. The instance using the default VRID
+// is always present, even without VIPs, and is the first of the list.
+// All the ports of a VIP come from the same configmap entry and therefore
+// share the same VRID.
+func getInstances(defaultVRID int, svcs []vip) []vrrpInstance {
+	groups := map[int][]string{defaultVRID: {}}
+	for _, svc := range svcs {
+		groups[svc.VRID] = appendIfMissing(groups[svc.VRID], svc.IP)
+	}
+
+	vrids := []int{}
+	for vrid := range groups {
+		if vrid != defaultVRID {
+			vrids = append(vrids, vrid)
+		}
+	}
+	sort.Ints(vrids)
+
+	instances := []vrrpInstance{{Name: "vips", VRID: defaultVRID, VIPs: groups[defaultVRID]}}
+	for _, vrid := range vrids {
+		instances = append(instances, vrrpInstance{
+			Name: fmt.Sprintf("vips-%v", vrid),
+			VRID: vrid,
+			VIPs: groups[vrid],
+		})
+	}
+
+	return instances
+}
+
 // Start starts a keepalived process in foreground.
 // In case of any error it will terminate the execution with a fatal error
 func (k *keepalived) Start() {
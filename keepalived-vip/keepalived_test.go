@@ -0,0 +1,271 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestKeepalived(t *testing.T) *keepalived {
+	k := &keepalived{
+		iface:       "eth0",
+		ip:          "10.4.0.3",
+		netmask:     24,
+		priority:    100,
+		vrid:        50,
+		vrrpVersion: 3,
+	}
+	if err := k.loadTemplate(); err != nil {
+		t.Fatalf("unexpected error loading template: %v", err)
+	}
+	return k
+}
+
+func TestDumpCfg(t *testing.T) {
+	k := newTestKeepalived(t)
+
+	svcs := []vip{
+		{
+			Name:      "default/echoheaders",
+			IP:        "10.4.0.50",
+			Port:      80,
+			Protocol:  "TCP",
+			LVSMethod: "NAT",
+			Backends:  []service{{IP: "10.2.68.5", Port: 8080}, {IP: "10.2.68.6", Port: 8080}},
+			VRID:      50,
+		},
+		{
+			IP:        "10.4.0.51",
+			Protocol:  "TCP",
+			LVSMethod: "VIP",
+			VRID:      50,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := k.DumpCfg(&buf, svcs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		"virtual_router_id 50",
+		"virtual_server 10.4.0.50 80 {",
+		"real_server 10.2.68.5 8080 {",
+		"# VIP Service with no pods: 10.4.0.51",
+		"TCP 10.4.0.50:80 NAT (default/echoheaders)\n  -> 10.2.68.5:8080\n  -> 10.2.68.6:8080\n",
+		"VIP 10.4.0.51 (no backends)",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected %q in the generated configuration:\n%v", e, out)
+		}
+	}
+}
+
+func TestTrackScriptCfg(t *testing.T) {
+	testcases := map[string]struct {
+		trackScript *vrrpScript
+		expected    []string
+		unexpected  []string
+	}{
+		"no track script": {
+			nil,
+			nil,
+			[]string{"vrrp_script", "track_script"},
+		},
+		"track script with weight": {
+			&vrrpScript{Script: "/check.sh", Interval: 5, Weight: -50},
+			[]string{
+				"vrrp_script chk_track_script {\n  script \"/check.sh\"\n  interval 5\n  weight -50\n}",
+				"track_script {\n    chk_track_script\n  }",
+			},
+			nil,
+		},
+		"track script without weight": {
+			&vrrpScript{Script: "/check.sh --port 80", Interval: 2},
+			[]string{
+				"script \"/check.sh --port 80\"",
+				"track_script {\n    chk_track_script\n  }",
+			},
+			[]string{"weight"},
+		},
+	}
+
+	for k, tc := range testcases {
+		ka := newTestKeepalived(t)
+		ka.trackScript = tc.trackScript
+
+		var buf bytes.Buffer
+		if err := ka.renderCfg(&buf, []vip{}); err != nil {
+			t.Fatalf("%s: unexpected error: %v", k, err)
+		}
+		out := buf.String()
+
+		for _, e := range tc.expected {
+			if !strings.Contains(out, e) {
+				t.Errorf("%s: expected %q in the generated configuration:\n%v", k, e, out)
+			}
+		}
+		for _, e := range tc.unexpected {
+			if strings.Contains(out, e) {
+				t.Errorf("%s: unexpected %q in the generated configuration:\n%v", k, e, out)
+			}
+		}
+	}
+}
+
+func TestVRRPScriptValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepalived")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	executable := filepath.Join(dir, "check.sh")
+	if err := ioutil.WriteFile(executable, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	notExecutable := filepath.Join(dir, "check.txt")
+	if err := ioutil.WriteFile(notExecutable, []byte(""), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testcases := map[string]struct {
+		script     vrrpScript
+		expectedOk bool
+	}{
+		"valid script":             {vrrpScript{Script: executable, Interval: 2, Weight: -20}, true},
+		"valid script with args":   {vrrpScript{Script: executable + " --port 80", Interval: 2}, true},
+		"empty script":             {vrrpScript{Script: " ", Interval: 2}, false},
+		"double quotes":            {vrrpScript{Script: executable + ` "--port 80"`, Interval: 2}, false},
+		"new line":                 {vrrpScript{Script: executable + "\n}\nvrrp_script other {", Interval: 2}, false},
+		"carriage return":          {vrrpScript{Script: executable + "\r", Interval: 2}, false},
+		"relative path":            {vrrpScript{Script: "check.sh", Interval: 2}, false},
+		"missing script":           {vrrpScript{Script: filepath.Join(dir, "missing.sh"), Interval: 2}, false},
+		"not executable":           {vrrpScript{Script: notExecutable, Interval: 2}, false},
+		"directory":                {vrrpScript{Script: dir, Interval: 2}, false},
+		"invalid interval":         {vrrpScript{Script: executable, Interval: 0}, false},
+		"weight out of range":      {vrrpScript{Script: executable, Interval: 2, Weight: -255}, false},
+		"positive weight in range": {vrrpScript{Script: executable, Interval: 2, Weight: 254}, true},
+	}
+
+	for k, tc := range testcases {
+		err := tc.script.validate()
+		if tc.expectedOk && err != nil {
+			t.Errorf("%s: unexpected error: %v", k, err)
+		}
+		if !tc.expectedOk && err == nil {
+			t.Errorf("%s: expected an error but the script was accepted: %+v", k, tc.script)
+		}
+	}
+}
+
+func TestGarpCfg(t *testing.T) {
+	k := newTestKeepalived(t)
+	k.garpMasterDelay = 10
+	k.garpMasterRefresh = 60
+
+	var buf bytes.Buffer
+	if err := k.renderCfg(&buf, []vip{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	for _, e := range []string{"garp_master_delay 10\n", "garp_master_refresh 60\n"} {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected %q in the generated configuration:\n%v", e, out)
+		}
+	}
+}
+
+func TestGetInstances(t *testing.T) {
+	testcases := map[string]struct {
+		svcs      []vip
+		instances []vrrpInstance
+	}{
+		"no VIPs": {
+			[]vip{},
+			[]vrrpInstance{{Name: "vips", VRID: 50, VIPs: []string{}}},
+		},
+		"default VRID": {
+			[]vip{
+				{IP: "10.4.0.50", Port: 80, VRID: 50},
+				{IP: "10.4.0.50", Port: 443, VRID: 50},
+				{IP: "10.4.0.51", Port: 80, VRID: 50},
+			},
+			[]vrrpInstance{{Name: "vips", VRID: 50, VIPs: []string{"10.4.0.50", "10.4.0.51"}}},
+		},
+		"one VRID per group": {
+			[]vip{
+				{IP: "10.4.0.50", Port: 80, VRID: 50},
+				{IP: "10.4.0.60", Port: 80, VRID: 61},
+				{IP: "10.4.0.61", Port: 80, VRID: 61},
+				{IP: "10.4.0.70", Port: 80, VRID: 52},
+			},
+			[]vrrpInstance{
+				{Name: "vips", VRID: 50, VIPs: []string{"10.4.0.50"}},
+				{Name: "vips-52", VRID: 52, VIPs: []string{"10.4.0.70"}},
+				{Name: "vips-61", VRID: 61, VIPs: []string{"10.4.0.60", "10.4.0.61"}},
+			},
+		},
+	}
+
+	for k, tc := range testcases {
+		instances := getInstances(50, tc.svcs)
+		if !reflect.DeepEqual(tc.instances, instances) {
+			t.Errorf("%s: expected %+v but returned %+v", k, tc.instances, instances)
+		}
+	}
+}
+
+func TestInstancesCfg(t *testing.T) {
+	k := newTestKeepalived(t)
+
+	svcs := []vip{
+		{IP: "10.4.0.50", Port: 0, Protocol: "TCP", LVSMethod: "VIP", VRID: 50},
+		{IP: "10.4.0.60", Port: 0, Protocol: "TCP", LVSMethod: "VIP", VRID: 61},
+	}
+
+	var buf bytes.Buffer
+	if err := k.renderCfg(&buf, svcs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		"vrrp_instance vips {\n  state BACKUP\n  interface eth0\n  virtual_router_id 50\n",
+		"virtual_ipaddress { \n    10.4.0.50\n  }",
+		"vrrp_instance vips-61 {\n  state BACKUP\n  interface eth0\n  virtual_router_id 61\n",
+		"virtual_ipaddress { \n    10.4.0.60\n  }",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected %q in the generated configuration:\n%v", e, out)
+		}
+	}
+
+	if n := strings.Count(out, "vrrp_instance "); n != 2 {
+		t.Errorf("expected 2 vrrp instances but %v were generated:\n%v", n, out)
+	}
+}
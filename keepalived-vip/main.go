@@ -62,7 +62,34 @@ var (
 	vrid = flags.Int("vrid", 50,
 		`The keepalived VRID (Virtual Router Identifier, between 0 and 255 as per
 			RFC-5798), which must be different for every Virtual Router (ie. every
-			keepalived sets) running on the same network.`)
+			keepalived sets) running on the same network. It can be overridden for a
+			group of IPs in the configmap using the suffix @<vrid>.`)
+
+	trackScript = flags.String("track-script", "",
+		`Absolute path (and optional arguments) of a script executed periodically by
+		keepalived to check the health of the node. While the script fails the node
+		yields the VIPs (see --track-script-weight).`)
+
+	trackScriptInterval = flags.Int("track-script-interval", 2,
+		`Number of seconds between two executions of the track script.`)
+
+	trackScriptWeight = flags.Int("track-script-weight", 0,
+		`Priority adjustment applied according to the result of the track script
+		(between -254 and 254). A negative value lowers the priority while the script
+		fails. If 0 a failure moves the node to the FAULT state, releasing the VIPs
+		immediately, which is recommended because the instances do not preempt.`)
+
+	garpMasterDelay = flags.Duration("garp-master-delay", 5*time.Second,
+		`Delay for the second set of gratuitous ARP messages sent after a node
+		becomes MASTER, in whole seconds. 0 disables the second set.`)
+
+	garpMasterRefresh = flags.Duration("garp-master-refresh", 0,
+		`Interval to refresh the gratuitous ARP messages while a node is MASTER,
+		in whole seconds. This helps peers with stale ARP caches. 0 disables the refresh.`)
+
+	dryRun = flags.Bool("dry-run", false, `if set, the keepalived configuration and the IPVS
+		services are generated once from the configmap and printed to the standard output. Neither
+		keepalived nor the kernel settings (ip_vs module, sysctl, IPVS table) are touched.`)
 )
 
 func main() {
@@ -105,29 +132,47 @@ func main() {
 		glog.Infof("watching namespace: '%v'", namespace)
 	}
 
-	err = loadIPVModule()
-	if err != nil {
-		glog.Fatalf("unexpected error: %v", err)
-	}
+	if *dryRun {
+		glog.Info("dry run: the generated configuration will not be applied")
+	} else {
+		err = loadIPVModule()
+		if err != nil {
+			glog.Fatalf("unexpected error: %v", err)
+		}
 
-	err = changeSysctl()
-	if err != nil {
-		glog.Fatalf("unexpected error: %v", err)
-	}
+		err = changeSysctl()
+		if err != nil {
+			glog.Fatalf("unexpected error: %v", err)
+		}
 
-	err = resetIPVS()
-	if err != nil {
-		glog.Fatalf("unexpected error: %v", err)
+		err = resetIPVS()
+		if err != nil {
+			glog.Fatalf("unexpected error: %v", err)
+		}
 	}
 
 	glog.Info("starting LVS configuration")
 	if *useUnicast {
 		glog.Info("keepalived will use unicast to sync the nodes")
 	}
-	ipvsc := newIPVSController(kubeClient, namespace, *useUnicast, *configMapName, *vrid, *vrrpVersion)
+	var chk *vrrpScript
+	if *trackScript != "" {
+		chk = &vrrpScript{
+			Script:   *trackScript,
+			Interval: *trackScriptInterval,
+			Weight:   *trackScriptWeight,
+		}
+	}
+
+	ipvsc := newIPVSController(kubeClient, namespace, *useUnicast, *configMapName, *vrid, *vrrpVersion, *dryRun, chk, *garpMasterDelay, *garpMasterRefresh)
 	go ipvsc.epController.Run(wait.NeverStop)
 	go ipvsc.svcController.Run(wait.NeverStop)
 
+	if *dryRun {
+		runDryRun(ipvsc)
+		return
+	}
+
 	go ipvsc.syncQueue.run(time.Second, ipvsc.stopCh)
 
 	go handleSigterm(ipvsc)
@@ -136,6 +181,23 @@ func main() {
 	ipvsc.keepalived.Start()
 }
 
+// runDryRun executes a single sync, once the informers are ready, printing
+// the configuration instead of applying it.
+func runDryRun(ipvsc *ipvsControllerController) {
+	err := wait.PollInfinite(100*time.Millisecond, func() (bool, error) {
+		err := ipvsc.sync("")
+		if err == errDeferredSync {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		glog.Fatalf("dry run failed: %v", err)
+	}
+
+	glog.Flush()
+}
+
 func handleSigterm(ipvsc *ipvsControllerController) {
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGTERM)
@@ -23,6 +23,7 @@ import (
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -269,6 +270,18 @@ func appendIfMissing(slice []string, item string) []string {
 	return append(slice, item)
 }
 
+// durationToSeconds converts a duration used in the keepalived configuration
+// to a number of seconds. Only positive (or zero) whole seconds are allowed.
+func durationToSeconds(name string, d time.Duration) (int, error) {
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %v %v, it cannot be negative", name, d)
+	}
+	if d%time.Second != 0 {
+		return 0, fmt.Errorf("invalid %v %v, it must be a whole number of seconds", name, d)
+	}
+	return int(d / time.Second), nil
+}
+
 func parseNsName(input string) (string, string, error) {
 	nsName := strings.Split(input, "/")
 	if len(nsName) != 2 {
@@ -278,6 +291,22 @@ func parseNsName(input string) (string, string, error) {
 	return nsName[0], nsName[1], nil
 }
 
+// parseVRID splits the optional VRID (@<vrid>) from the end of a configmap
+// value. It returns -1 as VRID if the value does not contain one.
+func parseVRID(input string) (string, int, error) {
+	pos := strings.LastIndex(input, "@")
+	if pos == -1 {
+		return input, -1, nil
+	}
+
+	vrid, err := strconv.Atoi(input[pos+1:])
+	if err != nil || vrid < 0 || vrid > 255 {
+		return "", -1, fmt.Errorf("invalid VRID found in '%v', only values between 0 and 255 are allowed", input)
+	}
+
+	return input[:pos], vrid, nil
+}
+
 func parseNsSvcLVS(input string) (string, string, string, error) {
 	nsSvcLb := nsSvcLbRegex.FindStringSubmatch(input)
 	if len(nsSvcLb) != 6 {
@@ -296,6 +325,10 @@ func parseNsSvcLVS(input string) (string, string, string, error) {
 		svc = nsSvcLb[5]
 	}
 
+	if ns == "" || svc == "" {
+		return "", "", "", fmt.Errorf("invalid format (namespace/service name[:NAT|DR]) found in '%v'", input)
+	}
+
 	if kind == "" {
 		kind = "NAT"
 	}
@@ -18,6 +18,7 @@ package main
 
 import (
 	"testing"
+	"time"
 )
 
 func TestParseNsSvcLVS(t *testing.T) {
@@ -34,6 +35,8 @@ func TestParseNsSvcLVS(t *testing.T) {
 		"with forward method":    {"default/echoheaders:NAT", "default", "echoheaders", "NAT", false},
 		"DR as forward method":   {"default/echoheaders:DR", "default", "echoheaders", "DR", false},
 		"invalid forward method": {"default/echoheaders:AJAX", "", "", "", true},
+		"empty namespace":        {"/echoheaders", "", "", "", true},
+		"empty service name":     {"default/:NAT", "", "", "", true},
 	}
 
 	for k, tc := range testcases {
@@ -56,3 +59,64 @@ func TestParseNsSvcLVS(t *testing.T) {
 		}
 	}
 }
+
+func TestDurationToSeconds(t *testing.T) {
+	testcases := map[string]struct {
+		Input      time.Duration
+		Seconds    int
+		ExpectedOk bool
+	}{
+		"zero":               {0, 0, false},
+		"whole seconds":      {5 * time.Second, 5, false},
+		"minutes":            {2 * time.Minute, 120, false},
+		"negative":           {-5 * time.Second, 0, true},
+		"fraction of second": {1500 * time.Millisecond, 0, true},
+	}
+
+	for k, tc := range testcases {
+		s, err := durationToSeconds("test", tc.Input)
+
+		if tc.ExpectedOk && err == nil {
+			t.Errorf("%s: expected an error but valid information returned: %v ", k, tc.Input)
+		}
+
+		if tc.Seconds != s {
+			t.Errorf("%s: expected %v but returned %v - input %v", k, tc.Seconds, s, tc.Input)
+		}
+	}
+}
+
+func TestParseVRID(t *testing.T) {
+	testcases := map[string]struct {
+		Input      string
+		Value      string
+		VRID       int
+		ExpectedOk bool
+	}{
+		"without VRID":         {"default/echoheaders:NAT", "default/echoheaders:NAT", -1, false},
+		"with VRID":            {"default/echoheaders:NAT@51", "default/echoheaders:NAT", 51, false},
+		"without forward":      {"default/echoheaders@0", "default/echoheaders", 0, false},
+		"VIP only":             {"", "", -1, false},
+		"VIP only with VRID":   {"@255", "", 255, false},
+		"VRID out of range":    {"default/echoheaders@256", "", -1, true},
+		"negative VRID":        {"default/echoheaders@-1", "", -1, true},
+		"VRID is not a number": {"default/echoheaders@abc", "", -1, true},
+		"empty VRID":           {"default/echoheaders@", "", -1, true},
+	}
+
+	for k, tc := range testcases {
+		value, vrid, err := parseVRID(tc.Input)
+
+		if tc.ExpectedOk && err == nil {
+			t.Errorf("%s: expected an error but valid information returned: %v ", k, tc.Input)
+		}
+
+		if tc.Value != value {
+			t.Errorf("%s: expected %v but returned %v - input %v", k, tc.Value, value, tc.Input)
+		}
+
+		if tc.VRID != vrid {
+			t.Errorf("%s: expected %v but returned %v - input %v", k, tc.VRID, vrid, tc.Input)
+		}
+	}
+}